@@ -0,0 +1,11 @@
+package dbutils
+
+// CliqueHashIndexBucket is the secondary index clique snapshots are written
+// to alongside the primary CliqueBucket entry: hash -> number, so a
+// snapshot can be looked up from just a hash without the caller already
+// knowing its number.
+var CliqueHashIndexBucket = []byte("clique-hash-to-number-")
+
+func init() {
+	Buckets = append(Buckets, CliqueHashIndexBucket)
+}
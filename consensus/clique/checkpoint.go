@@ -0,0 +1,175 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+
+	lru "github.com/hashicorp/golang-lru"
+	json "github.com/json-iterator/go"
+)
+
+// errCheckpointQuorum is returned when a checkpoint's signatures don't cover
+// more than half of its own declared signer set.
+var errCheckpointQuorum = errors.New("clique: checkpoint signatures do not reach quorum")
+
+// checkpointRecent and checkpointTally are sorted-slice stand-ins for the
+// maps on params.CliqueCheckpoint, used only to build a canonical encoding
+// to sign/verify over (see checkpointSigningHash).
+type checkpointRecent struct {
+	Number uint64
+	Signer common.Address
+}
+
+type checkpointTally struct {
+	Address   common.Address
+	Authorize bool
+	Votes     int
+}
+
+// checkpointSigningHash returns the hash that a checkpoint's Sigs are made
+// over. json-iterator's default Marshal does not sort map keys, so signing
+// checkpoint.Recents/checkpoint.Tally directly as maps would make the hash
+// depend on map iteration order - the signer and a verifier could compute
+// different hashes for the same logical checkpoint. Flattening both into
+// sorted slices first makes the encoding canonical.
+func checkpointSigningHash(checkpoint *params.CliqueCheckpoint) common.Hash {
+	recents := make([]checkpointRecent, 0, len(checkpoint.Recents))
+	for number, signer := range checkpoint.Recents {
+		recents = append(recents, checkpointRecent{number, signer})
+	}
+	sort.Slice(recents, func(i, j int) bool { return recents[i].Number < recents[j].Number })
+
+	tally := make([]checkpointTally, 0, len(checkpoint.Tally))
+	for addr, t := range checkpoint.Tally {
+		tally = append(tally, checkpointTally{addr, t.Authorize, t.Votes})
+	}
+	sort.Slice(tally, func(i, j int) bool { return bytes.Compare(tally[i].Address[:], tally[j].Address[:]) < 0 })
+
+	blob, err := json.Marshal(struct {
+		Number  uint64
+		Hash    common.Hash
+		Signers []common.Address
+		Recents []checkpointRecent
+		Tally   []checkpointTally
+	}{checkpoint.Number, checkpoint.Hash, checkpoint.Signers, recents, tally})
+	if err != nil {
+		// Every field above is a plain value/slice of plain values; this can
+		// only fail on a programming error.
+		panic(fmt.Sprintf("clique: marshal checkpoint payload: %v", err))
+	}
+	return crypto.Keccak256Hash(blob)
+}
+
+// verifyCheckpointQuorum checks that checkpoint.Sigs contains valid
+// signatures, over the checkpoint payload, from more than half of the
+// signers the checkpoint itself declares.
+func verifyCheckpointQuorum(checkpoint *params.CliqueCheckpoint) error {
+	declared := make(map[common.Address]struct{}, len(checkpoint.Signers))
+	for _, signer := range checkpoint.Signers {
+		declared[signer] = struct{}{}
+	}
+
+	hash := checkpointSigningHash(checkpoint)
+	signed := make(map[common.Address]struct{}, len(checkpoint.Sigs))
+	for _, sig := range checkpoint.Sigs {
+		pubkey, err := crypto.SigToPub(hash[:], sig)
+		if err != nil {
+			return fmt.Errorf("recover checkpoint signer: %v", err)
+		}
+		addr := crypto.PubkeyToAddress(*pubkey)
+		if _, ok := declared[addr]; !ok {
+			// Signature from someone outside the declared signer set doesn't
+			// count towards quorum, but isn't by itself an error - it may be a
+			// signer that has since been voted out.
+			continue
+		}
+		signed[addr] = struct{}{}
+	}
+
+	if len(signed)*2 <= len(checkpoint.Signers) {
+		return errCheckpointQuorum
+	}
+	return nil
+}
+
+// LoadCheckpoint verifies that checkpoint.Sigs represents a quorum (>50%) of
+// the signers the checkpoint itself declares, then materializes the
+// checkpoint into the clique bucket as a Snapshot and returns it. The write
+// is forced (storage.save(..., force=true)) so it lands immediately rather
+// than waiting on the background batcher, mirroring how the genesis
+// snapshot is persisted.
+//
+// provider and stateAt are threaded straight into the resulting Snapshot, the
+// same as a freshly loaded one - without them, a checkpoint-bootstrapped
+// snapshot on a UseValidatorContract chain would silently fall back to
+// Coinbase/Nonce vote-tally rotation on its very next epoch boundary.
+func LoadCheckpoint(db ethdb.Database, config *params.CliqueConfig, snapStorage *storage, sigcache *lru.ARCCache, checkpoint *params.CliqueCheckpoint, provider ValidatorProvider, stateAt StateAtFunc) (*Snapshot, error) {
+	if err := verifyCheckpointQuorum(checkpoint); err != nil {
+		return nil, err
+	}
+
+	snap := newSnapshot(config, snapStorage, sigcache, checkpoint.Number, checkpoint.Hash, checkpoint.Signers, provider, stateAt)
+	snap.Recents = make(map[uint64]common.Address, len(checkpoint.Recents))
+	for number, signer := range checkpoint.Recents {
+		snap.Recents[number] = signer
+	}
+	snap.Tally = make(map[common.Address]Tally, len(checkpoint.Tally))
+	for addr, t := range checkpoint.Tally {
+		snap.Tally[addr] = Tally{Authorize: t.Authorize, Votes: t.Votes}
+	}
+
+	if err := snap.store(db, true); err != nil {
+		return nil, fmt.Errorf("store checkpoint snapshot: %v", err)
+	}
+	return snap, nil
+}
+
+// bestCheckpoint returns the highest *valid* checkpoint in checkpoints whose
+// number is <= maxNumber, or nil if none qualify. Clique.snapshot uses this
+// to prefer a trusted checkpoint over genesis replay when no local snapshot
+// is available yet.
+//
+// "Valid" means its Sigs reach quorum: a checkpoint that fails
+// verifyCheckpointQuorum is skipped in favor of the next-highest candidate
+// rather than being handed to LoadCheckpoint, which would just reject it and
+// leave snapshot() with no fallback.
+func bestCheckpoint(checkpoints []params.CliqueCheckpoint, maxNumber uint64) *params.CliqueCheckpoint {
+	candidates := make([]*params.CliqueCheckpoint, 0, len(checkpoints))
+	for i := range checkpoints {
+		if checkpoints[i].Number <= maxNumber {
+			candidates = append(candidates, &checkpoints[i])
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Number > candidates[j].Number })
+
+	for _, cp := range candidates {
+		if err := verifyCheckpointQuorum(cp); err != nil {
+			continue
+		}
+		return cp
+	}
+	return nil
+}
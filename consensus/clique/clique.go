@@ -0,0 +1,115 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// inmemorySignatures is the number of recent block signatures to keep in
+// memory, to speed up the repeated ecrecover calls apply() makes.
+const inmemorySignatures = 4096
+
+// errUnknownSnapshot is returned by Clique.snapshot when neither a local
+// snapshot nor a trusted checkpoint covers the requested block.
+var errUnknownSnapshot = errors.New("clique: no snapshot or trusted checkpoint available for block")
+
+// ContractCaller executes input as a read-only call to contractAddr,
+// evaluated against state. It's how Clique reaches into the EVM to run
+// getValidators() without this package importing the full core/vm stack.
+type ContractCaller func(contractAddr common.Address, input []byte, number uint64, hash common.Hash, state *state.IntraBlockState) ([]byte, error)
+
+// Clique is the proof-of-authority consensus engine.
+type Clique struct {
+	config *params.CliqueConfig
+	db     ethdb.Database
+
+	sigcache    *lru.ARCCache
+	snapStorage *storage
+	provider    ValidatorProvider
+	api         *API
+}
+
+// New creates a Clique proof-of-authority consensus engine. callContract is
+// only used when config.UseValidatorContract is set; callers that don't use
+// the validator-contract path may pass nil. headerByNumber backs the
+// engine's read-only API (GetVotesBetween). config.RecoverConcurrency is
+// read directly by Snapshot.apply to size its ecrecover worker pool; New
+// does no extra wiring for it beyond passing config through.
+func New(config *params.CliqueConfig, db ethdb.Database, callContract ContractCaller, headerByNumber func(uint64) (*types.Header, error)) (*Clique, error) {
+	sigcache, err := lru.NewARC(inmemorySignatures)
+	if err != nil {
+		return nil, fmt.Errorf("create signature cache: %v", err)
+	}
+
+	c := &Clique{
+		config:      config,
+		db:          db,
+		sigcache:    sigcache,
+		snapStorage: newStorage(db),
+	}
+
+	if config.UseValidatorContract {
+		if callContract == nil {
+			return nil, errors.New("clique: UseValidatorContract is set but no ContractCaller was provided")
+		}
+		provider, err := newContractValidatorProvider(config.ValidatorContract, callContract)
+		if err != nil {
+			return nil, fmt.Errorf("build validator contract provider: %v", err)
+		}
+		c.provider = provider
+	}
+
+	c.api = NewAPI(db, config, c.snapStorage, sigcache, headerByNumber)
+
+	return c, nil
+}
+
+// API returns the read-only RPC surface backed by this engine's snapshots.
+func (c *Clique) API() *API {
+	return c.api
+}
+
+// snapshot resolves the Snapshot at (number, hash). If nothing has been
+// persisted locally yet, it falls back to the highest configured trusted
+// checkpoint at or below number instead of requiring a full genesis replay.
+// In that case the Snapshot returned is the one at the checkpoint's own
+// height; headers between it and number are not applied here. stateAt is threaded through to the configured ValidatorProvider, if any.
+func (c *Clique) snapshot(number uint64, hash common.Hash, stateAt StateAtFunc) (*Snapshot, error) {
+	ok, err := hasSnapshotData(c.db, number, hash)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return loadAndFillSnapshot(c.db, number, hash, c.config, c.snapStorage, c.sigcache, c.provider, stateAt)
+	}
+
+	if cp := bestCheckpoint(c.config.TrustedCheckpoints, number); cp != nil {
+		return LoadCheckpoint(c.db, c.config, c.snapStorage, c.sigcache, cp, c.provider, stateAt)
+	}
+
+	return nil, errUnknownSnapshot
+}
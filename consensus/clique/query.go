@@ -0,0 +1,183 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+
+	lru "github.com/hashicorp/golang-lru"
+	json "github.com/json-iterator/go"
+)
+
+// getNumberByHash resolves a block number from CliqueHashIndexBucket, the
+// secondary index populated alongside every snapshot save.
+func getNumberByHash(db ethdb.Database, hash common.Hash) (uint64, error) {
+	v, err := db.Get(dbutils.CliqueHashIndexBucket, hash.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return dbutils.DecodeBlockNumber(v)
+}
+
+// getSnapshotByHash is the hash-only counterpart of getSnapshotData: it goes
+// through CliqueHashIndexBucket to find the number, then reads the snapshot
+// as usual.
+func getSnapshotByHash(db ethdb.Database, hash common.Hash) ([]byte, uint64, error) {
+	number, err := getNumberByHash(db, hash)
+	if err != nil {
+		return nil, 0, fmt.Errorf("resolve number for hash %x: %v", hash, err)
+	}
+	blob, err := getSnapshotData(db, number, hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	return blob, number, nil
+}
+
+// LoadByHash is the hash-only counterpart of loadAndFillSnapshot: callers
+// that only have a block hash (e.g. RPC consumers) don't need to translate
+// it to a number via eth_getBlockByHash first.
+func LoadByHash(db ethdb.Database, hash common.Hash, config *params.CliqueConfig, snapStorage *storage, sigcache *lru.ARCCache) (*Snapshot, error) {
+	blob, _, err := getSnapshotByHash(db, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := new(Snapshot)
+	if err := json.Unmarshal(blob, snap); err != nil {
+		return nil, err
+	}
+
+	snap.config = config
+	snap.sigcache = sigcache
+	snap.snapStorage = snapStorage
+	return snap, nil
+}
+
+// API exposes clique snapshot data to RPC callers. Unlike the consensus
+// engine's own bookkeeping it is read-only: it never mutates the
+// database, only ever loading and re-deriving from what's already there.
+type API struct {
+	db             ethdb.Database
+	config         *params.CliqueConfig
+	sigcache       *lru.ARCCache
+	snapStorage    *storage
+	headerByNumber func(number uint64) (*types.Header, error)
+}
+
+// NewAPI builds a clique API backed by db. headerByNumber is used only by
+// GetVotesBetween, to resolve the hash a given height's snapshot (if any)
+// was stored under.
+func NewAPI(db ethdb.Database, config *params.CliqueConfig, snapStorage *storage, sigcache *lru.ARCCache, headerByNumber func(uint64) (*types.Header, error)) *API {
+	return &API{
+		db:             db,
+		config:         config,
+		sigcache:       sigcache,
+		snapStorage:    snapStorage,
+		headerByNumber: headerByNumber,
+	}
+}
+
+// GetSnapshotAtHash returns the full snapshot stored for hash.
+func (api *API) GetSnapshotAtHash(hash common.Hash) (*Snapshot, error) {
+	return LoadByHash(api.db, hash, api.config, api.snapStorage, api.sigcache)
+}
+
+// GetSignersAtHash returns the authorized signer set stored for hash, in
+// ascending order.
+func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
+	snap, err := api.GetSnapshotAtHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return snap.signers(), nil
+}
+
+// voteKey identifies a vote for deduplication purposes: the same vote shows
+// up in every snapshot persisted after it was cast and before the next
+// epoch boundary, since Snapshot.Votes holds the whole in-flight segment.
+type voteKey struct {
+	signer, address common.Address
+	block            uint64
+}
+
+// GetVotesBetween reconstructs the chronological vote history between
+// fromBlock and toBlock (inclusive) by walking the stored snapshots in that
+// window. Epoch boundaries reset Snapshot.Votes, so the segments are
+// stitched back together here rather than read off a single snapshot.
+//
+// Coverage depends entirely on a snapshot having been persisted at every
+// block checked: a vote cast and then resolved between two sparsely-stored
+// snapshots is invisible to this reconstruction. Rather than silently
+// return a window that looks complete, the count of blocks with no
+// persisted snapshot is logged so callers have a way to tell an empty
+// result from an incomplete one.
+func (api *API) GetVotesBetween(fromBlock, toBlock uint64) ([]*Vote, error) {
+	if fromBlock > toBlock {
+		return nil, fmt.Errorf("fromBlock %d is after toBlock %d", fromBlock, toBlock)
+	}
+
+	seen := make(map[voteKey]struct{})
+	var votes []*Vote
+	var missingSnapshots uint64
+
+	for number := fromBlock; number <= toBlock; number++ {
+		header, err := api.headerByNumber(number)
+		if err != nil {
+			return nil, fmt.Errorf("header at block %d: %v", number, err)
+		}
+		ok, err := hasSnapshotData(api.db, number, header.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("check snapshot at block %d: %v", number, err)
+		}
+		if !ok {
+			missingSnapshots++
+			continue
+		}
+		snap, err := loadSnapshot(api.db, number, header.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("load snapshot at block %d: %v", number, err)
+		}
+		for _, vote := range snap.Votes {
+			if vote.Block < fromBlock || vote.Block > toBlock {
+				continue
+			}
+			key := voteKey{vote.Signer, vote.Address, vote.Block}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			votes = append(votes, vote)
+		}
+	}
+
+	if missingSnapshots > 0 {
+		log.Warn("GetVotesBetween: some blocks in range have no persisted snapshot, vote history may be incomplete",
+			"fromBlock", fromBlock, "toBlock", toBlock, "blocksWithoutSnapshot", missingSnapshots)
+	}
+
+	sort.Slice(votes, func(i, j int) bool { return votes[i].Block < votes[j].Block })
+	return votes, nil
+}
@@ -18,12 +18,15 @@ package clique
 
 import (
 	"bytes"
+	"fmt"
+	"runtime"
 	"sort"
 	"sync/atomic"
 	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
@@ -33,6 +36,14 @@ import (
 	json "github.com/json-iterator/go"
 )
 
+// StateAtFunc resolves the IntraBlockState rooted at the block identified by
+// hash. Snapshot.apply calls it with an epoch block's number and the hash of
+// that block's parent, so the state returned is the parent's. It is
+// used to feed a ValidatorProvider when one is configured, so Snapshot.apply
+// can ask it "who are the signers at this block" without reaching into the
+// chain itself.
+type StateAtFunc func(number uint64, hash common.Hash) (*state.IntraBlockState, error)
+
 // Vote represents a single vote that an authorized signer made to modify the
 // list of authorizations.
 type Vote struct {
@@ -62,6 +73,13 @@ type Snapshot struct {
 	Tally   map[common.Address]Tally    `json:"tally"`   // Current vote tally to avoid recalculating
 
 	snapStorage *storage
+
+	// provider, when non-nil (config.UseValidatorContract), takes over signer
+	// rotation on epoch boundaries instead of the vote/tally machinery below -
+	// the Ronin/Consortium approach. stateAt supplies the IntraBlockState it
+	// needs to evaluate itself against the canonical chain.
+	provider ValidatorProvider
+	stateAt  StateAtFunc
 }
 
 // signersAscending implements the sort interface to allow sorting a list of addresses
@@ -74,7 +92,7 @@ func (s signersAscending) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 // newSnapshot creates a new snapshot with the specified startup parameters. This
 // method does not initialize the set of recent signers, so only ever use if for
 // the genesis block.
-func newSnapshot(config *params.CliqueConfig, snapStorage *storage, sigcache *lru.ARCCache, number uint64, hash common.Hash, signers []common.Address) *Snapshot {
+func newSnapshot(config *params.CliqueConfig, snapStorage *storage, sigcache *lru.ARCCache, number uint64, hash common.Hash, signers []common.Address, provider ValidatorProvider, stateAt StateAtFunc) *Snapshot {
 	snap := &Snapshot{
 		config:      config,
 		sigcache:    sigcache,
@@ -84,6 +102,8 @@ func newSnapshot(config *params.CliqueConfig, snapStorage *storage, sigcache *lr
 		Recents:     make(map[uint64]common.Address),
 		Tally:       make(map[common.Address]Tally),
 		snapStorage: snapStorage,
+		provider:    provider,
+		stateAt:     stateAt,
 	}
 	for _, signer := range signers {
 		snap.Signers[signer] = struct{}{}
@@ -92,7 +112,7 @@ func newSnapshot(config *params.CliqueConfig, snapStorage *storage, sigcache *lr
 }
 
 // loadSnapshot loads an existing snapshot from the database.
-func loadAndFillSnapshot(db ethdb.Database, num uint64, hash common.Hash, config *params.CliqueConfig, snapStorage *storage, sigcache *lru.ARCCache) (*Snapshot, error) {
+func loadAndFillSnapshot(db ethdb.Database, num uint64, hash common.Hash, config *params.CliqueConfig, snapStorage *storage, sigcache *lru.ARCCache, provider ValidatorProvider, stateAt StateAtFunc) (*Snapshot, error) {
 	snap, err := loadSnapshot(db, num, hash)
 	if err != nil {
 		return nil, err
@@ -101,6 +121,8 @@ func loadAndFillSnapshot(db ethdb.Database, num uint64, hash common.Hash, config
 	snap.config = config
 	snap.sigcache = sigcache
 	snap.snapStorage = snapStorage
+	snap.provider = provider
+	snap.stateAt = stateAt
 
 	return snap, nil
 }
@@ -128,6 +150,20 @@ func hasSnapshotData(db ethdb.Database, num uint64, hash common.Hash) (bool, err
 	return db.Has(dbutils.CliqueBucket, dbutils.BlockBodyKey(num, hash))
 }
 
+// hashIndexWriter is satisfied by both ethdb.Database and ethdb.Batch, so
+// putHashIndex can be used from both the forced single-snapshot save path
+// and the batched one.
+type hashIndexWriter interface {
+	Put(bucket, key, value []byte) error
+}
+
+// putHashIndex records hash -> number in CliqueHashIndexBucket, the
+// secondary index that lets a snapshot be looked up from just a hash instead
+// of requiring the caller to already know its number.
+func putHashIndex(w hashIndexWriter, number uint64, hash common.Hash) error {
+	return w.Put(dbutils.CliqueHashIndexBucket, hash.Bytes(), dbutils.EncodeBlockNumber(number))
+}
+
 // store inserts the snapshot into the database.
 func (s *Snapshot) store(db ethdb.Database, force bool) error {
 	ok, err := hasSnapshotData(db, s.Number, s.Hash)
@@ -189,6 +225,53 @@ func (s *Snapshot) uncast(address common.Address, authorize bool) bool {
 	return true
 }
 
+// recoverSigners ecrecovers every header in headers concurrently across
+// workers goroutines, and returns per-index result/error slices plus a
+// per-index channel that's closed once that header's recovery completes.
+// sigcache is shared across all workers; the ARC cache is already safe for
+// concurrent Add/Get, and keying recovery by header hash means two workers
+// racing on the same header just both do (or skip) the same work rather than
+// corrupting anything.
+func recoverSigners(headers []*types.Header, sigcache *lru.ARCCache, workers int) (signers []common.Address, errs []error, done []chan struct{}) {
+	n := len(headers)
+	signers = make([]common.Address, n)
+	errs = make([]error, n)
+	done = make([]chan struct{}, n)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	// Headers are consumed newest-first by apply()'s serial loop, so feed the
+	// pool in the same order to keep it running ahead rather than behind.
+	jobs := make(chan int, workers*4)
+	go func() {
+		defer close(jobs)
+		for i := n - 1; i >= 0; i-- {
+			jobs <- i
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for idx := range jobs {
+				signer, err := ecrecover(headers[idx], sigcache)
+				signers[idx] = signer
+				errs[idx] = err
+				close(done[idx])
+			}
+		}()
+	}
+
+	return signers, errs, done
+}
+
 // apply creates a new authorization snapshot by applying the given headers to
 // the original one.
 func (s *Snapshot) apply(headers ...*types.Header) error {
@@ -213,24 +296,39 @@ func (s *Snapshot) apply(headers ...*types.Header) error {
 		logged = start
 	)
 
+	useProvider := s.config.UseValidatorContract && s.provider != nil
+
+	// ecrecover is the dominant cost of replaying a long run of headers, and
+	// it's independent per header, so run it in a worker pool ahead of the
+	// serial loop below instead of inline. The pool streams results back in
+	// the same order apply() consumes them in (newest header first), so the
+	// serial loop only ever blocks waiting for a recovery that isn't already
+	// done.
+	recoverWorkers := int(s.config.RecoverConcurrency)
+	if recoverWorkers <= 0 {
+		recoverWorkers = runtime.NumCPU()
+	}
+	signers, recoverErrs, recovered := recoverSigners(headers, s.sigcache, recoverWorkers)
+
 	for i := len(headers) - 1; i >= 0; i-- {
 		header := headers[i]
 
-		// Remove any votes on checkpoint blocks
-		number := header.Number.Uint64()
-		if number%s.config.Epoch == 0 {
-			s.Votes = nil
-			s.Tally = make(map[common.Address]Tally)
+		<-recovered[i]
+		if err := recoverErrs[i]; err != nil {
+			return err
 		}
+		signer := signers[i]
+		number := header.Number.Uint64()
+
 		// Delete the oldest signer from the recent list to allow it signing again
 		if limit := uint64(len(s.Signers)/2 + 1); number >= limit {
 			delete(s.Recents, number-limit)
 		}
-		// Resolve the authorization key and check against signers
-		signer, err := ecrecover(header, s.sigcache)
-		if err != nil {
-			return err
-		}
+		// Authorize against the signer set as it stood *before* this header -
+		// an epoch header is signed under the outgoing set, so the provider
+		// rotation below (which replaces s.Signers) must happen after this
+		// check, or a signer that's rotated out at this very block would
+		// spuriously fail its own epoch-closing header.
 		if _, ok := s.Signers[signer]; !ok {
 			return errUnauthorizedSigner
 		}
@@ -241,6 +339,33 @@ func (s *Snapshot) apply(headers ...*types.Header) error {
 		}
 		s.Recents[number] = signer
 
+		// Remove any votes on checkpoint blocks
+		if number%s.config.Epoch == 0 {
+			s.Votes = nil
+			s.Tally = make(map[common.Address]Tally)
+
+			if useProvider {
+				// Signer rotation is governed externally: rebuild Signers from
+				// the provider instead of tallying Coinbase/Nonce votes.
+				// Evaluated at the parent state root, since this block's own
+				// state isn't committed yet while apply() is replaying it.
+				if err := s.refreshSignersFromProvider(number, header.ParentHash); err != nil {
+					return err
+				}
+			}
+		}
+
+		if useProvider {
+			// The provider owns the signer set; the vote/tally paths below are
+			// skipped entirely so a Coinbase/Nonce encoding left over from a
+			// non-consortium chain can't sneak a vote through.
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Reconstructing voting history", "processed", i, "total", len(headers), "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+			continue
+		}
+
 		// Header authorized, discard any previous votes from the signer
 		for voteIdx, vote := range s.Votes {
 			if vote.Signer == signer && vote.Address == header.Coinbase {
@@ -318,6 +443,30 @@ func (s *Snapshot) apply(headers ...*types.Header) error {
 	return nil
 }
 
+// refreshSignersFromProvider asks the configured ValidatorProvider who the
+// signers are for the epoch starting at number, and replaces s.Signers with
+// its answer. parentHash identifies the state root the provider is
+// evaluated against - the parent of number, since number's own state isn't
+// committed yet while Snapshot.apply is still replaying it. It leaves
+// s.Signers untouched if the provider errors, so a failed lookup mid-epoch
+// can't corrupt an otherwise-good snapshot.
+func (s *Snapshot) refreshSignersFromProvider(number uint64, parentHash common.Hash) error {
+	ibs, err := s.stateAt(number, parentHash)
+	if err != nil {
+		return fmt.Errorf("resolve state for validator provider at %d (parent %x): %v", number, parentHash, err)
+	}
+	signers, err := s.provider.SignersAt(number, parentHash, ibs)
+	if err != nil {
+		return fmt.Errorf("validator provider at %d (parent %x): %v", number, parentHash, err)
+	}
+	next := make(map[common.Address]struct{}, len(signers))
+	for _, signer := range signers {
+		next[signer] = struct{}{}
+	}
+	s.Signers = next
+	return nil
+}
+
 // signers retrieves the list of authorized signers in ascending order.
 func (s *Snapshot) signers() []common.Address {
 	sigs := make([]common.Address, 0, len(s.Signers))
@@ -438,6 +587,9 @@ func (st *storage) save(number uint64, hash common.Hash, blob []byte, force bool
 		if err := st.db.Append(dbutils.CliqueBucket, dbutils.BlockBodyKey(snap.number, snap.hash), snap.blob); err != nil {
 			log.Error("can't store a snapshot", "block", snap.number, "hash", snap.hash, "err", err)
 		}
+		if err := putHashIndex(st.db, snap.number, snap.hash); err != nil {
+			log.Error("can't store a snapshot hash index", "block", snap.number, "hash", snap.hash, "err", err)
+		}
 	}
 }
 
@@ -460,6 +612,9 @@ func (st *storage) saveSnaps(snaps []*snapObj, isSorted bool) {
 		if err := batch.Append(dbutils.CliqueBucket, dbutils.BlockBodyKey(snap.number, snap.hash), snap.blob); err != nil {
 			log.Error("can't store a snapshot", "block", snap.number, "hash", snap.hash, "err", err)
 		}
+		if err := putHashIndex(batch, snap.number, snap.hash); err != nil {
+			log.Error("can't store a snapshot hash index", "block", snap.number, "hash", snap.hash, "err", err)
+		}
 	}
 
 	if _, err := batch.Commit(); err != nil {
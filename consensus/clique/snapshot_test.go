@@ -0,0 +1,107 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+var (
+	addrA = common.HexToAddress("0x0000000000000000000000000000000000000a")
+	addrB = common.HexToAddress("0x0000000000000000000000000000000000000b")
+	addrC = common.HexToAddress("0x0000000000000000000000000000000000000c")
+)
+
+func noopStateAt(number uint64, hash common.Hash) (*state.IntraBlockState, error) {
+	return nil, nil
+}
+
+type failingProvider struct{ err error }
+
+func (p failingProvider) SignersAt(number uint64, hash common.Hash, ibs *state.IntraBlockState) ([]common.Address, error) {
+	return nil, p.err
+}
+
+// TestRefreshSignersFromProvider_FailureLeavesSignersUntouched covers the
+// mid-epoch provider failure case required by the validator-provider
+// request: a failing lookup must not leave the snapshot with a
+// partially-rotated (or emptied) signer set.
+func TestRefreshSignersFromProvider_FailureLeavesSignersUntouched(t *testing.T) {
+	cfg := &params.CliqueConfig{Epoch: 30000, UseValidatorContract: true}
+	snap := newSnapshot(cfg, nil, nil, 100, common.Hash{}, []common.Address{addrA, addrB}, failingProvider{errors.New("boom")}, noopStateAt)
+
+	want := map[common.Address]struct{}{addrA: {}, addrB: {}}
+
+	if err := snap.refreshSignersFromProvider(30000, common.HexToHash("0x1")); err == nil {
+		t.Fatal("expected an error from a failing provider")
+	}
+	if !reflect.DeepEqual(snap.Signers, want) {
+		t.Fatalf("Signers mutated by a failing provider call: got %v, want %v", snap.Signers, want)
+	}
+}
+
+type branchProvider struct {
+	byParent map[common.Hash][]common.Address
+}
+
+func (p branchProvider) SignersAt(number uint64, parentHash common.Hash, ibs *state.IntraBlockState) ([]common.Address, error) {
+	signers, ok := p.byParent[parentHash]
+	if !ok {
+		return nil, errors.New("unknown parent")
+	}
+	return signers, nil
+}
+
+// TestRefreshSignersFromProvider_ReorgAcrossEpochBoundary covers a reorg
+// that lands on a sibling branch at the same epoch boundary: the signer set
+// must reflect whichever parent state is supplied, with no leftover state
+// from the abandoned branch.
+func TestRefreshSignersFromProvider_ReorgAcrossEpochBoundary(t *testing.T) {
+	branchA := common.HexToHash("0xa")
+	branchB := common.HexToHash("0xb")
+
+	provider := branchProvider{byParent: map[common.Hash][]common.Address{
+		branchA: {addrA},
+		branchB: {addrB},
+	}}
+
+	cfg := &params.CliqueConfig{Epoch: 30000, UseValidatorContract: true}
+	snap := newSnapshot(cfg, nil, nil, 100, common.Hash{}, nil, provider, noopStateAt)
+
+	if err := snap.refreshSignersFromProvider(30000, branchA); err != nil {
+		t.Fatalf("branch A: %v", err)
+	}
+	if _, ok := snap.Signers[addrA]; !ok {
+		t.Fatal("expected addrA to be authorized on branch A")
+	}
+
+	if err := snap.refreshSignersFromProvider(30000, branchB); err != nil {
+		t.Fatalf("branch B: %v", err)
+	}
+	if _, ok := snap.Signers[addrB]; !ok {
+		t.Fatal("expected addrB to be authorized on branch B")
+	}
+	if _, ok := snap.Signers[addrA]; ok {
+		t.Fatal("stale addrA from the abandoned branch A should not survive the reorg")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/accounts/abi"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+)
+
+// ValidatorProvider abstracts how the authorized signer set at a given block
+// is determined. When a Snapshot is configured with one (params.CliqueConfig.
+// UseValidatorContract), Snapshot.apply defers to it on epoch boundaries
+// instead of replaying the header vote/tally machinery - the Ronin/
+// Consortium approach, where Coinbase/Nonce vote encoding is ignored and
+// signer rotation is governed by a contract on the canonical chain.
+type ValidatorProvider interface {
+	// SignersAt returns the authorized signer set for the epoch starting at
+	// block number. Snapshot.apply passes the hash of number's parent as hash,
+	// and state is the IntraBlockState rooted at that parent, so
+	// implementations can run read-only calls against it without touching the
+	// live chain state.
+	SignersAt(number uint64, hash common.Hash, state *state.IntraBlockState) ([]common.Address, error)
+}
+
+// getValidatorsABI is the minimal ABI fragment turbo-geth needs to call
+// getValidators() on a validator-set contract and decode its address[] result.
+const getValidatorsABI = `[{"constant":true,"inputs":[],"name":"getValidators","outputs":[{"name":"","type":"address[]"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+// contractValidatorProvider is a ValidatorProvider that resolves the signer
+// set by executing a read-only call to getValidators() against a well-known
+// contract address, evaluated at the parent state root of the requested
+// block. callContract performs the actual EVM call; it is injected so the
+// provider can be unit tested without a full blockchain.
+type contractValidatorProvider struct {
+	contractAddr common.Address
+	abi          abi.ABI
+	callContract func(contractAddr common.Address, input []byte, number uint64, hash common.Hash, state *state.IntraBlockState) ([]byte, error)
+}
+
+// newContractValidatorProvider builds a ValidatorProvider bound to contractAddr.
+// callContract is expected to execute input as a message call against state
+// and return the ABI-encoded return data.
+func newContractValidatorProvider(contractAddr common.Address, callContract func(common.Address, []byte, uint64, common.Hash, *state.IntraBlockState) ([]byte, error)) (*contractValidatorProvider, error) {
+	parsed, err := abi.JSON(strings.NewReader(getValidatorsABI))
+	if err != nil {
+		return nil, fmt.Errorf("parse getValidators ABI: %v", err)
+	}
+	return &contractValidatorProvider{
+		contractAddr: contractAddr,
+		abi:          parsed,
+		callContract: callContract,
+	}, nil
+}
+
+// SignersAt implements ValidatorProvider by invoking getValidators() on the
+// configured contract and decoding the returned address list.
+func (p *contractValidatorProvider) SignersAt(number uint64, hash common.Hash, ibs *state.IntraBlockState) ([]common.Address, error) {
+	input, err := p.abi.Pack("getValidators")
+	if err != nil {
+		return nil, fmt.Errorf("pack getValidators call: %v", err)
+	}
+	ret, err := p.callContract(p.contractAddr, input, number, hash, ibs)
+	if err != nil {
+		return nil, fmt.Errorf("call getValidators at %d (%x): %v", number, hash, err)
+	}
+	var signers []common.Address
+	if err := p.abi.Unpack(&signers, "getValidators", ret); err != nil {
+		return nil, fmt.Errorf("unpack getValidators result: %v", err)
+	}
+	return signers, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// CliqueConfig is the consensus engine configs for proof-of-authority based
+// sealing.
+type CliqueConfig struct {
+	Period uint64 `json:"period"` // Number of seconds between blocks to enforce
+	Epoch  uint64 `json:"epoch"`  // Epoch length to reset votes and checkpoint
+
+	// UseValidatorContract switches signer rotation away from the header
+	// Coinbase/Nonce vote encoding to an external validator-set contract,
+	// evaluated at ValidatorContract on every epoch boundary - the
+	// Ronin/Consortium approach. When false, the classic vote/tally
+	// machinery in Snapshot.apply governs the signer set.
+	UseValidatorContract bool           `json:"useValidatorContract,omitempty"`
+	ValidatorContract    common.Address `json:"validatorContract,omitempty"`
+
+	// TrustedCheckpoints lets snap-sync bootstrap a Snapshot from a signed
+	// checkpoint instead of replaying every header since genesis.
+	TrustedCheckpoints []CliqueCheckpoint `json:"trustedCheckpoints,omitempty"`
+
+	// RecoverConcurrency bounds the worker pool Snapshot.apply uses to
+	// ecrecover signer addresses out of a batch of headers. Zero (the
+	// default) means runtime.NumCPU().
+	RecoverConcurrency int `json:"recoverConcurrency,omitempty"`
+}
+
+// String implements the stringer interface, formatting and returning the
+// consensus engine details.
+func (c *CliqueConfig) String() string {
+	return "clique"
+}
+
+// CliqueTally mirrors clique.Tally. It's redeclared here, rather than
+// imported, so CliqueCheckpoint can be embedded in CliqueConfig without
+// params importing the clique package (which already imports params).
+type CliqueTally struct {
+	Authorize bool `json:"authorize"`
+	Votes     int  `json:"votes"`
+}
+
+// CliqueCheckpoint is a trusted, signed snapshot of clique voting state at a
+// given height. It lets a node bootstrap a Snapshot without replaying every
+// header back to genesis (or the last persisted snapshot), which is what
+// makes snap-sync painful on long clique chains.
+type CliqueCheckpoint struct {
+	Number  uint64                         `json:"number"`  // Block number the checkpoint was taken at
+	Hash    common.Hash                    `json:"hash"`    // Block hash the checkpoint was taken at
+	Signers []common.Address               `json:"signers"` // Authorized signer set at Number
+	Recents map[uint64]common.Address      `json:"recents"` // Recent signers, for spam protection, as of Number
+	Tally   map[common.Address]CliqueTally `json:"tally"`   // In-flight vote tally as of Number
+	Sigs    [][]byte                       `json:"sigs"`    // Multi-signature over the payload by a quorum of Signers
+}